@@ -0,0 +1,424 @@
+package nett
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+var onReconnectedNop = func(conn Connection) {}
+
+// defaultInitialBackoff is the delay before the first reconnect attempt.
+const defaultInitialBackoff = 500 * time.Millisecond
+
+// defaultMaxBackoff caps the exponential backoff between reconnect attempts.
+const defaultMaxBackoff = 30 * time.Second
+
+// defaultPendingQueueSize caps how many Send/SendAsync calls are buffered
+// while Dial has no established connection.
+const defaultPendingQueueSize = 64
+
+// DialOptions configures the auto-reconnecting Connection returned by Dial.
+type DialOptions struct {
+
+	// InitialBackoff is how long Dial waits before the first reconnect
+	// attempt. Defaults to 500ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the exponential backoff between reconnect attempts.
+	// Defaults to 30s.
+	MaxBackoff time.Duration
+
+	// MaxAttempts is how many consecutive failed reconnect attempts Dial
+	// tolerates before giving up and firing OnClosed. Zero (the default)
+	// retries forever.
+	MaxAttempts int
+
+	// PendingQueueSize caps how many Send/SendAsync calls are buffered
+	// while no connection is established. The oldest buffered message is
+	// dropped to make room once the limit is reached. Defaults to 64.
+	PendingQueueSize int
+
+	// Options configures the keepalive and send queue behavior of each
+	// underlying Connection established by Dial.
+	Options Options
+}
+
+func (o DialOptions) initialBackoff() time.Duration {
+	if o.InitialBackoff > 0 {
+		return o.InitialBackoff
+	}
+	return defaultInitialBackoff
+}
+
+func (o DialOptions) maxBackoff() time.Duration {
+	if o.MaxBackoff > 0 {
+		return o.MaxBackoff
+	}
+	return defaultMaxBackoff
+}
+
+func (o DialOptions) pendingQueueSize() int {
+	if o.PendingQueueSize > 0 {
+		return o.PendingQueueSize
+	}
+	return defaultPendingQueueSize
+}
+
+// dialConn is the Connection returned by Dial. It owns a single, possibly
+// nil, underlying Connection (current) that it swaps out on every reconnect,
+// re-registering the caller's OnData/OnErr handlers on each new one.
+type dialConn struct {
+	network  string
+	addr     string
+	reader   ReaderFunc
+	dialOpts DialOptions
+
+	onData          func(conn Connection, data []byte)
+	onErr           func(conn Connection, err error)
+	onClosed        func(conn Connection)
+	onReconnected   func(conn Connection)
+	onQueueOverflow func(conn Connection)
+
+	stopped   chan struct{}
+	stopOnce  sync.Once
+	closeOnce sync.Once
+
+	mutex       sync.Mutex
+	conn        Connection
+	established bool
+	pending     [][]byte
+}
+
+// Dial establishes a Connection to network/addr and keeps it alive: whenever
+// the underlying net.Conn errors or the peer closes it, Dial waits
+// InitialBackoff and then redials with exponential backoff (capped at
+// MaxBackoff, with jitter), re-registering the caller's OnData/OnErr
+// handlers on the new connection and firing OnReconnected. Send and
+// SendAsync calls made while no connection is established are queued, up to
+// DialOptions.PendingQueueSize, rather than failing. Dial gives up after
+// MaxAttempts consecutive failed attempts (0 means never) and only then
+// fires OnClosed.
+func Dial(network, addr string, reader ReaderFunc, opts DialOptions) Connection {
+	d := &dialConn{
+		network:         network,
+		addr:            addr,
+		reader:          reader,
+		dialOpts:        opts,
+		onData:          onDataNop,
+		onErr:           onErrNop,
+		onClosed:        onClosedNop,
+		onReconnected:   onReconnectedNop,
+		onQueueOverflow: onQueueOverflowNop,
+		stopped:         make(chan struct{}),
+	}
+
+	go d.run()
+
+	return d
+}
+
+func (d *dialConn) run() {
+	attempt := 0
+	backoff := d.dialOpts.initialBackoff()
+
+	for {
+		select {
+		case <-d.stopped:
+			return
+		default:
+		}
+
+		conn, done, err := d.connect()
+		if err != nil {
+			attempt++
+			if d.dialOpts.MaxAttempts > 0 && attempt >= d.dialOpts.MaxAttempts {
+				d.giveUp()
+				return
+			}
+			if !d.sleepBackoff(backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff, d.dialOpts.maxBackoff())
+			continue
+		}
+
+		reconnected := d.adopt(conn)
+		attempt = 0
+		backoff = d.dialOpts.initialBackoff()
+		if reconnected {
+			d.notifyReconnected()
+		}
+
+		select {
+		case <-done:
+			// the connection died after being live, not on dial; still
+			// honor InitialBackoff before the next redial attempt; until
+			// then Send/SendAsync queue instead of hitting the dead conn
+			d.mutex.Lock()
+			if d.conn == conn {
+				d.conn = nil
+			}
+			d.mutex.Unlock()
+			if !d.sleepBackoff(d.dialOpts.initialBackoff()) {
+				return
+			}
+		case <-d.stopped:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (d *dialConn) connect() (Connection, <-chan struct{}, error) {
+	rawConn, err := net.Dial(d.network, d.addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn := WrapWithOptions(rawConn, d.reader, d.dialOpts.Options)
+
+	done := make(chan struct{})
+	conn.OnClosed(func(conn Connection) {
+		close(done)
+	})
+
+	return conn, done, nil
+}
+
+// adopt wires the caller's handlers onto conn, makes it the current
+// connection and flushes any messages queued while disconnected. It returns
+// true unless conn is the very first connection Dial ever established.
+func (d *dialConn) adopt(conn Connection) bool {
+	d.mutex.Lock()
+	reconnected := d.established
+	d.established = true
+	d.conn = conn
+	onData := d.onData
+	onErr := d.onErr
+	onQueueOverflow := d.onQueueOverflow
+	pending := d.pending
+	d.pending = nil
+	d.mutex.Unlock()
+
+	conn.OnData(onData)
+	conn.OnErr(onErr)
+	conn.OnQueueOverflow(onQueueOverflow)
+
+	for _, data := range pending {
+		conn.SendAsync(data)
+	}
+
+	return reconnected
+}
+
+func (d *dialConn) sleepBackoff(backoff time.Duration) bool {
+	select {
+	case <-time.After(jitter(backoff)):
+		return true
+	case <-d.stopped:
+		return false
+	}
+}
+
+// jitter returns a random duration in [backoff/2, backoff], so that many
+// reconnecting clients don't retry in lockstep.
+func jitter(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half+1)))
+}
+
+func nextBackoff(cur, max time.Duration) time.Duration {
+	next := cur * 2
+	if next <= 0 || next > max {
+		return max
+	}
+	return next
+}
+
+func (d *dialConn) Raw() net.Conn {
+	d.mutex.Lock()
+	conn := d.conn
+	d.mutex.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Raw()
+}
+
+func (d *dialConn) OnData(handler func(conn Connection, data []byte)) {
+	if handler == nil {
+		handler = onDataNop
+	}
+	wrapped := func(_ Connection, data []byte) { handler(d, data) }
+
+	d.mutex.Lock()
+	d.onData = wrapped
+	conn := d.conn
+	d.mutex.Unlock()
+
+	if conn != nil {
+		conn.OnData(wrapped)
+	}
+}
+
+func (d *dialConn) OnErr(handler func(conn Connection, err error)) {
+	if handler == nil {
+		handler = onErrNop
+	}
+	wrapped := func(_ Connection, err error) { handler(d, err) }
+
+	d.mutex.Lock()
+	d.onErr = wrapped
+	conn := d.conn
+	d.mutex.Unlock()
+
+	if conn != nil {
+		conn.OnErr(wrapped)
+	}
+}
+
+// OnClosed registers the *handler* that will be called once Dial gives up
+// reconnecting (MaxAttempts exhausted) or Close is called. It is never
+// called for the transient disconnects in between.
+func (d *dialConn) OnClosed(handler func(conn Connection)) {
+	if handler == nil {
+		handler = onClosedNop
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.onClosed = handler
+}
+
+// OnReconnected registers the *handler* that will be called every time Dial
+// re-establishes a connection after the first one.
+func (d *dialConn) OnReconnected(handler func(conn Connection)) {
+	if handler == nil {
+		handler = onReconnectedNop
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.onReconnected = handler
+}
+
+func (d *dialConn) notifyReconnected() {
+	d.mutex.Lock()
+	handler := d.onReconnected
+	d.mutex.Unlock()
+
+	handler(d)
+}
+
+// Send writes data via the current connection, or queues it if Dial is
+// between connections.
+func (d *dialConn) Send(data []byte) error {
+	d.mutex.Lock()
+	conn := d.conn
+	d.mutex.Unlock()
+
+	if conn == nil {
+		d.enqueuePending(data)
+		return nil
+	}
+
+	return conn.Send(data)
+}
+
+// SendAsync enqueues data on the current connection's send queue, or queues
+// it if Dial is between connections.
+func (d *dialConn) SendAsync(data []byte) {
+	d.mutex.Lock()
+	conn := d.conn
+	d.mutex.Unlock()
+
+	if conn == nil {
+		d.enqueuePending(data)
+		return
+	}
+
+	conn.SendAsync(data)
+}
+
+func (d *dialConn) enqueuePending(data []byte) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.pending) >= d.dialOpts.pendingQueueSize() {
+		d.pending = d.pending[1:]
+	}
+	d.pending = append(d.pending, data)
+}
+
+func (d *dialConn) QueueLen() int {
+	d.mutex.Lock()
+	conn := d.conn
+	pending := len(d.pending)
+	d.mutex.Unlock()
+
+	if conn == nil {
+		return pending
+	}
+	return conn.QueueLen()
+}
+
+func (d *dialConn) OnQueueOverflow(handler func(conn Connection)) {
+	if handler == nil {
+		handler = onQueueOverflowNop
+	}
+	wrapped := func(_ Connection) { handler(d) }
+
+	d.mutex.Lock()
+	d.onQueueOverflow = wrapped
+	conn := d.conn
+	d.mutex.Unlock()
+
+	if conn != nil {
+		conn.OnQueueOverflow(wrapped)
+	}
+}
+
+func (d *dialConn) Metrics() Metrics {
+	d.mutex.Lock()
+	conn := d.conn
+	d.mutex.Unlock()
+
+	if conn == nil {
+		return Metrics{}
+	}
+	return conn.Metrics()
+}
+
+// Close permanently stops Dial's reconnect loop, closes the current
+// connection and fires OnClosed.
+func (d *dialConn) Close() {
+	d.stopOnce.Do(func() { close(d.stopped) })
+
+	d.mutex.Lock()
+	conn := d.conn
+	d.mutex.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+
+	d.giveUp()
+}
+
+func (d *dialConn) giveUp() {
+	d.closeOnce.Do(func() {
+		d.mutex.Lock()
+		handler := d.onClosed
+		d.mutex.Unlock()
+
+		handler(d)
+	})
+}
@@ -0,0 +1,143 @@
+package nett_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-braun/nett"
+)
+
+func TestDialReconnectsAfterDisconnect(t *testing.T) {
+	server, addr := createListener(t)
+	defer server.Close()
+
+	connChan := make(chan net.Conn, 4)
+	go func() {
+		for {
+			c, err := server.Accept()
+			if err != nil {
+				return
+			}
+			connChan <- c
+		}
+	}()
+
+	read := createReader(mockMsg)
+
+	client := nett.Dial("tcp", addr.String(), read, nett.DialOptions{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+	})
+	defer client.Close()
+
+	reconnected := make(chan struct{}, 1)
+	client.OnReconnected(func(conn nett.Connection) {
+		reconnected <- struct{}{}
+	})
+
+	server1 := <-connChan
+	server1.Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Dial to reconnect")
+	}
+
+	server2 := <-connChan
+	defer server2.Close()
+}
+
+func TestDialHonorsInitialBackoffAfterLiveDisconnect(t *testing.T) {
+	server, addr := createListener(t)
+	defer server.Close()
+
+	type accepted struct {
+		conn net.Conn
+		at   time.Time
+	}
+	acceptChan := make(chan accepted, 4)
+	go func() {
+		for {
+			c, err := server.Accept()
+			if err != nil {
+				return
+			}
+			acceptChan <- accepted{conn: c, at: time.Now()}
+		}
+	}()
+
+	read := createReader(mockMsg)
+	backoff := 150 * time.Millisecond
+	client := nett.Dial("tcp", addr.String(), read, nett.DialOptions{
+		InitialBackoff: backoff,
+		MaxBackoff:     backoff,
+	})
+	defer client.Close()
+
+	first := <-acceptChan
+	closedAt := time.Now()
+	first.conn.Close()
+
+	second := <-acceptChan
+	defer second.conn.Close()
+
+	// jitter() returns somewhere in [backoff/2, backoff], so the elapsed
+	// time should never drop much below half of InitialBackoff
+	assert.GreaterOrEqual(t, second.at.Sub(closedAt), backoff/2-10*time.Millisecond)
+}
+
+func TestDialGivesUpAfterMaxAttempts(t *testing.T) {
+	read := createReader(mockMsg)
+
+	client := nett.Dial("tcp", "localhost:1", read, nett.DialOptions{
+		InitialBackoff: 5 * time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		MaxAttempts:    3,
+	})
+	defer client.Close()
+
+	closed := make(chan struct{})
+	client.OnClosed(func(conn nett.Connection) {
+		close(closed)
+	})
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Dial to give up and fire OnClosed")
+	}
+}
+
+func TestDialQueuesSendWhileDisconnected(t *testing.T) {
+	server, addr := createListener(t)
+	defer server.Close()
+	connChan := accept(t, server)
+
+	read := createReader(mockMsg)
+
+	client := nett.Dial("tcp", addr.String(), read, nett.DialOptions{
+		InitialBackoff: 10 * time.Millisecond,
+	})
+	defer client.Close()
+
+	client.SendAsync(mockMsg)
+
+	serverRaw := <-connChan
+	serverClient := nett.Wrap(serverRaw, read)
+	defer serverClient.Close()
+
+	received := make(chan struct{})
+	serverClient.OnData(func(conn nett.Connection, data []byte) {
+		assert.Equal(t, mockMsg, data)
+		close(received)
+	})
+
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected queued SendAsync to be delivered once connected")
+	}
+}
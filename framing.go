@@ -0,0 +1,104 @@
+package nett
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// ErrFrameTooLarge is returned by a LengthPrefixReader when a peer announces
+// a payload length that exceeds the configured maxFrame.
+var ErrFrameTooLarge = errors.New("nett: frame exceeds maxFrame")
+
+// ErrInvalidPrefixSize is returned by LengthPrefixReader and WriteFramed when
+// prefixSize is not one of 1, 2, 4 or 8.
+var ErrInvalidPrefixSize = errors.New("nett: prefixSize must be 1, 2, 4 or 8")
+
+// LengthPrefixReader returns a ReaderFunc that reads a fixed size length
+// header (1, 2, 4 or 8 bytes, encoded using the given binary.ByteOrder)
+// followed by exactly that many payload bytes, and returns the payload
+// (without the header) to OnData.
+//
+// maxFrame protects against hostile or broken peers announcing huge
+// lengths; a header claiming more than maxFrame bytes is reported as
+// ErrFrameTooLarge without attempting to read the payload.
+func LengthPrefixReader(order binary.ByteOrder, prefixSize int, maxFrame int) func(rawConn net.Conn) ([]byte, error) {
+	return func(rawConn net.Conn) ([]byte, error) {
+		header := make([]byte, prefixSize)
+		if _, err := io.ReadFull(rawConn, header); err != nil {
+			return nil, err
+		}
+
+		length, err := decodeFrameLength(order, header)
+		if err != nil {
+			return nil, err
+		}
+
+		if length > uint64(maxFrame) {
+			return nil, ErrFrameTooLarge
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(rawConn, payload); err != nil {
+			return nil, err
+		}
+
+		return payload, nil
+	}
+}
+
+// WriteFramed prepends a length header (as configured via order and
+// prefixSize) to payload and sends it through conn, so a peer reading with
+// the matching LengthPrefixReader can reassemble it.
+func WriteFramed(conn Connection, order binary.ByteOrder, prefixSize int, payload []byte) error {
+	framed, err := encodeFrame(order, prefixSize, payload)
+	if err != nil {
+		return err
+	}
+
+	return conn.Send(framed)
+}
+
+func encodeFrame(order binary.ByteOrder, prefixSize int, payload []byte) ([]byte, error) {
+	header := make([]byte, prefixSize)
+	switch prefixSize {
+	case 1:
+		if len(payload) > 0xff {
+			return nil, fmt.Errorf("nett: payload of %d bytes does not fit a 1 byte prefix", len(payload))
+		}
+		header[0] = byte(len(payload))
+	case 2:
+		if len(payload) > 0xffff {
+			return nil, fmt.Errorf("nett: payload of %d bytes does not fit a 2 byte prefix", len(payload))
+		}
+		order.PutUint16(header, uint16(len(payload)))
+	case 4:
+		if len(payload) > 0xffffffff {
+			return nil, fmt.Errorf("nett: payload of %d bytes does not fit a 4 byte prefix", len(payload))
+		}
+		order.PutUint32(header, uint32(len(payload)))
+	case 8:
+		order.PutUint64(header, uint64(len(payload)))
+	default:
+		return nil, ErrInvalidPrefixSize
+	}
+
+	return append(header, payload...), nil
+}
+
+func decodeFrameLength(order binary.ByteOrder, header []byte) (uint64, error) {
+	switch len(header) {
+	case 1:
+		return uint64(header[0]), nil
+	case 2:
+		return uint64(order.Uint16(header)), nil
+	case 4:
+		return uint64(order.Uint32(header)), nil
+	case 8:
+		return order.Uint64(header), nil
+	default:
+		return 0, ErrInvalidPrefixSize
+	}
+}
@@ -0,0 +1,90 @@
+package nett_test
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-braun/nett"
+)
+
+func TestLengthPrefixReader(t *testing.T) {
+	c1, c2 := net.Pipe()
+
+	reader := nett.LengthPrefixReader(binary.BigEndian, 4, 1024)
+	client1 := nett.Wrap(c1, nett.ReadLineReader)
+	client2 := nett.Wrap(c2, reader)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	var received []byte
+	client2.OnData(func(conn nett.Connection, data []byte) {
+		received = data
+		wg.Done()
+	})
+
+	err := nett.WriteFramed(client1, binary.BigEndian, 4, mockMsg)
+	assert.NoError(t, err)
+
+	wg.Wait()
+	assert.Equal(t, mockMsg, received)
+
+	client1.Close()
+	client2.Close()
+}
+
+func TestLengthPrefixReaderTooLarge(t *testing.T) {
+	c1, c2 := net.Pipe()
+
+	reader := nett.LengthPrefixReader(binary.BigEndian, 4, 4)
+	client1 := nett.Wrap(c1, nett.ReadLineReader)
+	client2 := nett.Wrap(c2, reader)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	var receivedErr error
+	client2.OnErr(func(conn nett.Connection, err error) {
+		receivedErr = err
+		wg.Done()
+	})
+
+	// the peer stops reading after the oversized header, so this write may
+	// itself fail once the pipe is torn down concurrently
+	go nett.WriteFramed(client1, binary.BigEndian, 4, mockMsg)
+
+	wg.Wait()
+	assert.Equal(t, nett.ErrFrameTooLarge, receivedErr)
+
+	client1.Close()
+	client2.Close()
+}
+
+func TestWriteFramedRejectsOversizedPayloadFor2BytePrefix(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	client1 := nett.Wrap(c1, nett.ReadLineReader)
+	defer client1.Close()
+
+	// a 2 byte prefix can only encode lengths up to 0xffff; a larger payload
+	// must be rejected before ever reaching Send, instead of silently
+	// truncating the header and desyncing the peer's LengthPrefixReader
+	oversized := make([]byte, 0x10000)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- nett.WriteFramed(client1, binary.BigEndian, 2, oversized)
+	}()
+
+	select {
+	case err := <-errChan:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected WriteFramed to reject the oversized payload instead of attempting to send it")
+	}
+}
@@ -0,0 +1,112 @@
+package nett
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrPongTimeout is the error delivered to OnErr when a peer does not
+// answer a ping with a pong within the configured PongTimeout.
+var ErrPongTimeout = errors.New("nett: pong timeout")
+
+// Options configures the keepalive and send queue behavior of a Connection
+// created via WrapWithOptions.
+type Options struct {
+
+	// PingInterval is how often a ping frame is sent to the peer. Zero disables keepalive.
+	PingInterval time.Duration
+
+	// PongTimeout is how long to wait for a pong reply before the connection
+	// is closed and OnErr fires with ErrPongTimeout.
+	PongTimeout time.Duration
+
+	// PingPayload is the exact bytes sent as a ping and recognized as one on the read side.
+	PingPayload []byte
+
+	// PongPayload is the exact bytes sent in reply to a ping and recognized as one on the read side.
+	PongPayload []byte
+
+	// SendQueueSize caps how many SendAsync messages may be buffered before
+	// OverflowPolicy kicks in. Defaults to 64.
+	SendQueueSize int
+
+	// OverflowPolicy decides what happens once the send queue is full. Defaults to Block.
+	OverflowPolicy OverflowPolicy
+}
+
+func (o Options) keepaliveEnabled() bool {
+	return o.PingInterval > 0 && len(o.PingPayload) > 0 && len(o.PongPayload) > 0
+}
+
+// WrapWithOptions is the same as Wrap but additionally enables ping/pong
+// keepalive as configured via opts: the connection periodically sends
+// PingPayload and expects PongPayload back within PongTimeout, closing the
+// connection (and firing OnErr with ErrPongTimeout) otherwise. Incoming
+// pings are answered automatically and incoming pongs never reach OnData.
+func WrapWithOptions(inner net.Conn, reader func(rawConn net.Conn) ([]byte, error), opts Options) Connection {
+	result := newConn(inner, reader, opts)
+
+	result.wg.Add(1)
+	go result.runRead()
+
+	result.wg.Add(1)
+	go result.runWrite()
+
+	if opts.keepaliveEnabled() {
+		result.wg.Add(1)
+		go result.runKeepalive()
+	}
+
+	return result
+}
+
+// handleKeepaliveFrame swallows ping/pong frames before they reach OnData,
+// auto-replying to pings. It returns true if data was a keepalive frame.
+func (c *conn) handleKeepaliveFrame(data []byte) bool {
+	if !c.opts.keepaliveEnabled() {
+		return false
+	}
+
+	if bytes.Equal(data, c.opts.PingPayload) {
+		c.SendAsync(c.opts.PongPayload)
+		return true
+	}
+
+	if bytes.Equal(data, c.opts.PongPayload) {
+		select {
+		case c.pongCh <- struct{}{}:
+		default:
+		}
+		return true
+	}
+
+	return false
+}
+
+func (c *conn) runKeepalive() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			c.SendAsync(c.opts.PingPayload)
+
+			select {
+			case <-c.pongCh:
+			case <-time.After(c.opts.PongTimeout):
+				c.notifyErr(ErrPongTimeout)
+				c.inner.Close()
+				return
+			case <-c.closed:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package nett_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-braun/nett"
+)
+
+func TestKeepaliveRepliesWithPong(t *testing.T) {
+	c1, c2 := createClients(t)
+
+	opts := nett.Options{
+		PingInterval: 10 * time.Millisecond,
+		PongTimeout:  100 * time.Millisecond,
+		PingPayload:  []byte("PING"),
+		PongPayload:  []byte("PONG"),
+	}
+
+	read := fixedSizeReader(4)
+	client1 := nett.WrapWithOptions(c1, read, opts)
+	client2 := nett.WrapWithOptions(c2, read, opts)
+
+	// ping/pong frames never surface to OnData; if they leaked through the
+	// keepalive handling would be broken
+	client1.OnData(func(conn nett.Connection, data []byte) {
+		t.Errorf("unexpected data on client1: %q", data)
+	})
+	client2.OnData(func(conn nett.Connection, data []byte) {
+		t.Errorf("unexpected data on client2: %q", data)
+	})
+
+	client1.OnErr(func(conn nett.Connection, err error) {
+		t.Errorf("unexpected error on client1: %v", err)
+	})
+	client2.OnErr(func(conn nett.Connection, err error) {
+		t.Errorf("unexpected error on client2: %v", err)
+	})
+
+	time.Sleep(120 * time.Millisecond)
+
+	// a ping/pong in flight can legitimately error out once Close tears
+	// down the connection, so stop asserting before shutting down
+	client1.OnErr(nil)
+	client2.OnErr(nil)
+
+	client1.Close()
+	client2.Close()
+}
+
+func TestKeepalivePongTimeout(t *testing.T) {
+	c1, c2 := createClients(t)
+	defer c2.Close()
+
+	opts := nett.Options{
+		PingInterval: 10 * time.Millisecond,
+		PongTimeout:  20 * time.Millisecond,
+		PingPayload:  []byte("PING"),
+		PongPayload:  []byte("PONG"),
+	}
+
+	client1 := nett.WrapWithOptions(c1, nett.ReadLineReader, opts)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	var received error
+	client1.OnErr(func(conn nett.Connection, err error) {
+		received = err
+		wg.Done()
+	})
+
+	wg.Wait()
+	assert.Equal(t, nett.ErrPongTimeout, received)
+
+	client1.Close()
+}
+
+func fixedSizeReader(size int) func(rawConn net.Conn) ([]byte, error) {
+	return func(rawConn net.Conn) ([]byte, error) {
+		data := make([]byte, size)
+		_, err := rawConn.Read(data)
+		return data, err
+	}
+}
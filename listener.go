@@ -0,0 +1,197 @@
+package nett
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+)
+
+var onConnectionNop = func(conn Connection) {}
+
+// Acceptor is the event based interface around a net.Listener
+// that auto-wraps every accepted net.Conn into a Connection.
+type Acceptor interface {
+
+	// Addr returns the address the underlining net.Listener is bound to
+	Addr() net.Addr
+
+	// ConnChan returns the channel that delivers newly accepted Connections.
+	// It buffers up to 16 undrained Connections; a Connection accepted while
+	// the buffer is full is not sent on ConnChan (OnConnection still gets it)
+	ConnChan() <-chan Connection
+
+	// OnConnection registers the *handler* that will be called for every newly accepted Connection
+	OnConnection(handler func(conn Connection))
+
+	// Stop closes the listener, waits for the accept loop to finish
+	// and closes every still open child Connection
+	Stop()
+}
+
+// connChanBuffer sizes the acceptor's ConnChan so that an OnConnection-only
+// consumer (the common fire-and-forget style) isn't required to also drain
+// ConnChan for the accept loop to make progress.
+const connChanBuffer = 16
+
+type acceptor struct {
+	inner        net.Listener
+	reader       func(rawConn net.Conn) ([]byte, error)
+	connChan     chan Connection
+	stopped      chan struct{}
+	stopOnce     sync.Once
+	onConnection func(conn Connection)
+	children     map[Connection]struct{}
+	mutex        sync.Mutex
+	wg           sync.WaitGroup
+}
+
+// Listen opens a listener on the given network/addr and returns an Acceptor
+// that wraps every accepted net.Conn via Wrap using the given reader.
+func Listen(network, addr string, reader func(rawConn net.Conn) ([]byte, error)) (Acceptor, error) {
+	inner, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return WrapListener(inner, reader), nil
+}
+
+// ListenTLS is the same as Listen but accepts TLS connections using the given config.
+func ListenTLS(network, addr string, config *tls.Config, reader func(rawConn net.Conn) ([]byte, error)) (Acceptor, error) {
+	inner, err := tls.Listen(network, addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return WrapListener(inner, reader), nil
+}
+
+// WrapListener will wrap the given net.Listener and return a nett.Acceptor object
+// that runs Accept in a background goroutine and wraps every accepted net.Conn via Wrap.
+func WrapListener(inner net.Listener, reader func(rawConn net.Conn) ([]byte, error)) Acceptor {
+	result := &acceptor{
+		inner:        inner,
+		reader:       reader,
+		connChan:     make(chan Connection, connChanBuffer),
+		stopped:      make(chan struct{}),
+		onConnection: onConnectionNop,
+		children:     map[Connection]struct{}{},
+	}
+
+	result.wg.Add(1)
+	go result.runAccept()
+
+	return result
+}
+
+func (a *acceptor) Addr() net.Addr {
+	return a.inner.Addr()
+}
+
+func (a *acceptor) ConnChan() <-chan Connection {
+	return a.connChan
+}
+
+func (a *acceptor) OnConnection(handler func(conn Connection)) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if handler == nil {
+		handler = onConnectionNop
+	}
+
+	a.onConnection = handler
+}
+
+func (a *acceptor) Stop() {
+	a.stopOnce.Do(func() { close(a.stopped) })
+	a.inner.Close()
+	a.wg.Wait()
+
+	a.mutex.Lock()
+	children := make([]Connection, 0, len(a.children))
+	for child := range a.children {
+		children = append(children, child)
+	}
+	a.mutex.Unlock()
+
+	for _, child := range children {
+		child.Close()
+	}
+}
+
+func (a *acceptor) runAccept() {
+	defer a.wg.Done()
+	defer close(a.connChan)
+
+	for {
+		rawConn, err := a.inner.Accept()
+		if err != nil {
+			return
+		}
+
+		child := a.trackChild(Wrap(rawConn, a.reader))
+
+		a.mutex.Lock()
+		handler := a.onConnection
+		a.mutex.Unlock()
+
+		handler(child)
+
+		// Non-blocking: an OnConnection-only consumer never drains
+		// ConnChan, and the accept loop must not wedge waiting for a
+		// reader that will never come.
+		select {
+		case a.connChan <- child:
+		default:
+		}
+	}
+}
+
+// trackChild wraps inner so the acceptor can track/untrack it via inner's
+// own OnClosed slot without occupying the *public* OnClosed slot the caller
+// sees on the returned Connection. That keeps the two independent: a caller
+// that sets its own OnClosed (e.g. via OnConnection) no longer clobbers the
+// acceptor's internal bookkeeping, and vice versa.
+func (a *acceptor) trackChild(inner Connection) Connection {
+	child := &acceptedConn{Connection: inner, onClosed: onClosedNop}
+
+	a.mutex.Lock()
+	a.children[child] = struct{}{}
+	a.mutex.Unlock()
+
+	inner.OnClosed(func(conn Connection) {
+		a.mutex.Lock()
+		delete(a.children, child)
+		a.mutex.Unlock()
+
+		child.mutex.Lock()
+		handler := child.onClosed
+		child.mutex.Unlock()
+
+		handler(child)
+	})
+
+	return child
+}
+
+// acceptedConn is the Connection handed out for every accepted child. It
+// delegates everything to the wrapped Connection except OnClosed, which it
+// keeps in its own slot so the acceptor's internal trackChild cleanup and
+// the caller's own OnClosed handler can never overwrite each other.
+type acceptedConn struct {
+	Connection
+	mutex    sync.Mutex
+	onClosed func(conn Connection)
+}
+
+func (c *acceptedConn) OnClosed(handler func(conn Connection)) {
+	if handler == nil {
+		handler = onClosedNop
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.onClosed = handler
+}
@@ -0,0 +1,84 @@
+package nett_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-braun/nett"
+)
+
+func TestListenAccepts(t *testing.T) {
+	acceptor, err := nett.Listen("tcp", "localhost:0", nett.ReadLineReader)
+	assert.NoError(t, err)
+	defer acceptor.Stop()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	acceptor.OnConnection(func(conn nett.Connection) {
+		wg.Done()
+	})
+
+	client, err := net.Dial("tcp", acceptor.Addr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	wg.Wait()
+}
+
+func TestListenConnChan(t *testing.T) {
+	acceptor, err := nett.Listen("tcp", "localhost:0", nett.ReadLineReader)
+	assert.NoError(t, err)
+	defer acceptor.Stop()
+
+	client, err := net.Dial("tcp", acceptor.Addr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	conn := <-acceptor.ConnChan()
+	assert.NotNil(t, conn)
+	conn.Close()
+}
+
+func TestListenOnConnectionOnlyDoesNotWedge(t *testing.T) {
+	acceptor, err := nett.Listen("tcp", "localhost:0", nett.ReadLineReader)
+	assert.NoError(t, err)
+	defer acceptor.Stop()
+
+	const dials = 3
+	wg := &sync.WaitGroup{}
+	wg.Add(dials)
+	acceptor.OnConnection(func(conn nett.Connection) {
+		wg.Done()
+	})
+
+	for i := 0; i < dials; i++ {
+		client, err := net.Dial("tcp", acceptor.Addr().String())
+		assert.NoError(t, err)
+		defer client.Close()
+	}
+
+	wg.Wait()
+}
+
+func TestListenStopClosesChildren(t *testing.T) {
+	acceptor, err := nett.Listen("tcp", "localhost:0", nett.ReadLineReader)
+	assert.NoError(t, err)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	acceptor.OnConnection(func(conn nett.Connection) {
+		conn.OnClosed(func(conn nett.Connection) {
+			wg.Done()
+		})
+	})
+
+	client, err := net.Dial("tcp", acceptor.Addr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	<-acceptor.ConnChan()
+	acceptor.Stop()
+	wg.Wait()
+}
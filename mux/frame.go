@@ -0,0 +1,108 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+// errInvalidFrame is returned by decodeFrame when the raw bytes delivered by
+// FrameReader do not contain a complete mux frame header.
+var errInvalidFrame = errors.New("mux: invalid frame")
+
+// FrameReader is the nett.ReaderFunc to register (via nett.Wrap) on every
+// net.Conn that will be handed to Wrap. It reads exactly one wire frame
+// ([chanID varint][EOF byte][chunk-len varint][chunk bytes]) per call and
+// hands the raw frame bytes upstream, where Wrap decodes them again.
+func FrameReader(rawConn net.Conn) ([]byte, error) {
+	var raw bytes.Buffer
+
+	if _, err := readUvarint(rawConn, &raw); err != nil {
+		return nil, err
+	}
+
+	eof := make([]byte, 1)
+	if _, err := io.ReadFull(rawConn, eof); err != nil {
+		return nil, err
+	}
+	raw.Write(eof)
+
+	length, err := readUvarint(rawConn, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if length > 0 {
+		chunk := make([]byte, length)
+		if _, err := io.ReadFull(rawConn, chunk); err != nil {
+			return nil, err
+		}
+		raw.Write(chunk)
+	}
+
+	return raw.Bytes(), nil
+}
+
+// encodeFrame serializes chID, the EOF marker and chunk into a single wire frame.
+func encodeFrame(chID byte, eof bool, chunk []byte) []byte {
+	header := make([]byte, binary.MaxVarintLen64+1+binary.MaxVarintLen64)
+
+	n := binary.PutUvarint(header, uint64(chID))
+
+	eofByte := byte(0)
+	if eof {
+		eofByte = 1
+	}
+	header[n] = eofByte
+	n++
+
+	n += binary.PutUvarint(header[n:], uint64(len(chunk)))
+
+	return append(header[:n], chunk...)
+}
+
+// decodeFrame is the inverse of encodeFrame, parsing a raw frame as delivered by FrameReader.
+func decodeFrame(raw []byte) (chID byte, eof bool, chunk []byte, err error) {
+	chIDVal, n := binary.Uvarint(raw)
+	if n <= 0 {
+		return 0, false, nil, errInvalidFrame
+	}
+	raw = raw[n:]
+
+	if len(raw) < 1 {
+		return 0, false, nil, errInvalidFrame
+	}
+	eof = raw[0] == 1
+	raw = raw[1:]
+
+	_, n = binary.Uvarint(raw)
+	if n <= 0 {
+		return 0, false, nil, errInvalidFrame
+	}
+	raw = raw[n:]
+
+	return byte(chIDVal), eof, raw, nil
+}
+
+func readUvarint(rawConn net.Conn, into *bytes.Buffer) (uint64, error) {
+	var x uint64
+	var s uint
+	b := make([]byte, 1)
+
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		if _, err := io.ReadFull(rawConn, b); err != nil {
+			return 0, err
+		}
+		into.Write(b)
+
+		if b[0] < 0x80 {
+			return x | uint64(b[0])<<s, nil
+		}
+		x |= uint64(b[0]&0x7f) << s
+		s += 7
+	}
+
+	return 0, errors.New("mux: varint overflow")
+}
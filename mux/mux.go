@@ -0,0 +1,358 @@
+// Package mux layers a Tendermint MConnection-style multiplexer on top of
+// an existing nett.Connection: multiple logical channels share one
+// underlying connection, each with its own bounded send queue and a
+// priority-aware scheduler that interleaves their traffic instead of
+// blocking on head-of-line channels.
+package mux
+
+import (
+	"sync"
+
+	"github.com/v-braun/nett"
+)
+
+const defaultMaxFrameSize = 1024
+
+// defaultMaxMessageSize caps how many bytes a channel reassembles from
+// chunked frames before a message's EOF chunk arrives.
+const defaultMaxMessageSize = 1 << 20 // 1 MiB
+
+// ChannelDescriptor declares a logical channel up front when calling Wrap.
+type ChannelDescriptor struct {
+	ID byte
+
+	// Priority weighs this channel in pickChannel's scheduling; a
+	// Priority <= 0 is treated as 1, since a literal 0 would always lose
+	// the priority/(1+recentBytes) comparison
+	Priority int
+
+	SendQueueCapacity int
+}
+
+// MConnection multiplexes many logical channels over a single nett.Connection.
+type MConnection interface {
+
+	// Send enqueues msg on chID's send queue, returning false (and dropping
+	// msg) if the queue is full.
+	Send(chID byte, msg []byte) bool
+
+	// TrySend is an alias of Send, kept for readability at call sites.
+	TrySend(chID byte, msg []byte) bool
+
+	// SendWithBackpressure enqueues msg on chID's send queue, blocking while the queue is full.
+	SendWithBackpressure(chID byte, msg []byte)
+
+	// OnReceive registers the *handler* that will be called with every
+	// reassembled message received on chID.
+	OnReceive(chID byte, handler func(chID byte, msg []byte))
+
+	// Close closes the underlying nett.Connection and stops the send loop.
+	Close()
+}
+
+// Option configures an MConnection created via Wrap.
+type Option func(*mconn)
+
+// MaxFrameSize caps how many payload bytes a single outbound frame may
+// carry; larger messages are chunked across several frames so they
+// interleave with other channels' traffic. Defaults to 1024.
+func MaxFrameSize(n int) Option {
+	return func(m *mconn) {
+		m.maxFrameSize = n
+	}
+}
+
+// MaxMessageSize caps how many bytes a channel will reassemble from
+// chunked frames before delivering (or dropping) a message. A peer that
+// keeps streaming non-EOF chunks past this limit has its partial message
+// dropped instead of growing it without bound. Defaults to 1 MiB.
+func MaxMessageSize(n int) Option {
+	return func(m *mconn) {
+		m.maxMessageSize = n
+	}
+}
+
+type channel struct {
+	desc        ChannelDescriptor
+	queue       chan []byte
+	onReceive   func(chID byte, msg []byte)
+	recentBytes int64
+	partial     []byte
+	// dropping is set once partial exceeds maxMessageSize, and cleared
+	// on the oversized message's EOF chunk, so the half of the message
+	// we already discarded can never be mistaken for a complete one.
+	dropping bool
+}
+
+type outboundState struct {
+	msg    []byte
+	offset int
+}
+
+type mconn struct {
+	conn           nett.Connection
+	channels       map[byte]*channel
+	outbound       map[byte]*outboundState
+	maxFrameSize   int
+	maxMessageSize int
+	wakeup         chan struct{}
+	closed         chan struct{}
+	closeOnce      sync.Once
+	mutex          sync.Mutex
+	wg             sync.WaitGroup
+}
+
+// Wrap layers a multiplexer over conn, which must have been created with
+// FrameReader as its nett.ReaderFunc. descriptors declares every channel
+// that will be used; sending on or receiving from an undeclared channel ID is a no-op.
+func Wrap(conn nett.Connection, descriptors []ChannelDescriptor, opts ...Option) MConnection {
+	m := &mconn{
+		conn:           conn,
+		channels:       map[byte]*channel{},
+		outbound:       map[byte]*outboundState{},
+		maxFrameSize:   defaultMaxFrameSize,
+		maxMessageSize: defaultMaxMessageSize,
+		wakeup:         make(chan struct{}, 1),
+		closed:         make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	for _, desc := range descriptors {
+		if desc.Priority <= 0 {
+			desc.Priority = 1
+		}
+
+		m.channels[desc.ID] = &channel{
+			desc:      desc,
+			queue:     make(chan []byte, desc.SendQueueCapacity),
+			onReceive: func(chID byte, msg []byte) {},
+		}
+	}
+
+	conn.OnData(m.onRawFrame)
+	conn.OnClosed(func(conn nett.Connection) {
+		m.closeOnce.Do(func() { close(m.closed) })
+	})
+
+	m.wg.Add(1)
+	go m.sendLoop()
+
+	return m
+}
+
+func (m *mconn) Send(chID byte, msg []byte) bool {
+	ch, ok := m.channel(chID)
+	if !ok {
+		return false
+	}
+
+	select {
+	case ch.queue <- msg:
+		m.notify()
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *mconn) TrySend(chID byte, msg []byte) bool {
+	return m.Send(chID, msg)
+}
+
+func (m *mconn) SendWithBackpressure(chID byte, msg []byte) {
+	ch, ok := m.channel(chID)
+	if !ok {
+		return
+	}
+
+	select {
+	case ch.queue <- msg:
+		m.notify()
+	case <-m.closed:
+	}
+}
+
+func (m *mconn) OnReceive(chID byte, handler func(chID byte, msg []byte)) {
+	ch, ok := m.channel(chID)
+	if !ok {
+		return
+	}
+
+	if handler == nil {
+		handler = func(chID byte, msg []byte) {}
+	}
+
+	m.mutex.Lock()
+	ch.onReceive = handler
+	m.mutex.Unlock()
+}
+
+func (m *mconn) Close() {
+	m.conn.Close()
+	m.closeOnce.Do(func() { close(m.closed) })
+	m.wg.Wait()
+}
+
+func (m *mconn) channel(chID byte) (*channel, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ch, ok := m.channels[chID]
+	return ch, ok
+}
+
+func (m *mconn) notify() {
+	select {
+	case m.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (m *mconn) onRawFrame(conn nett.Connection, raw []byte) {
+	chID, eof, chunk, err := decodeFrame(raw)
+	if err != nil {
+		return
+	}
+
+	m.mutex.Lock()
+	ch, ok := m.channels[chID]
+	if !ok {
+		m.mutex.Unlock()
+		return
+	}
+
+	if ch.dropping {
+		ch.dropping = !eof
+		m.mutex.Unlock()
+		return
+	}
+
+	if len(ch.partial)+len(chunk) > m.maxMessageSize {
+		// peer is streaming an oversized (or never-EOF) message; drop
+		// what we have instead of growing ch.partial without bound
+		ch.partial = nil
+		ch.dropping = !eof
+		m.mutex.Unlock()
+		return
+	}
+
+	ch.partial = append(ch.partial, chunk...)
+
+	var msg []byte
+	if eof {
+		msg = ch.partial
+		ch.partial = nil
+	}
+	handler := ch.onReceive
+	m.mutex.Unlock()
+
+	if eof {
+		handler(chID, msg)
+	}
+}
+
+func (m *mconn) sendLoop() {
+	defer m.wg.Done()
+
+	for {
+		chID, hasWork := m.pickChannel()
+		if !hasWork {
+			select {
+			case <-m.wakeup:
+				continue
+			case <-m.closed:
+				return
+			}
+		}
+
+		if err := m.writeNextChunk(chID); err != nil {
+			return
+		}
+
+		select {
+		case <-m.closed:
+			return
+		default:
+		}
+	}
+}
+
+// pickChannel selects the channel with work (a queued message or an
+// in-progress chunked send) that maximizes priority / (1 + recentBytes),
+// so higher priority channels win but can't starve others forever since
+// recentBytes decays every time a chunk is written.
+func (m *mconn) pickChannel() (byte, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var best *channel
+	var bestScore float64
+
+	for _, ch := range m.channels {
+		if m.outbound[ch.desc.ID] == nil && len(ch.queue) == 0 {
+			continue
+		}
+
+		score := float64(ch.desc.Priority) / float64(1+ch.recentBytes)
+		if best == nil || score > bestScore {
+			best = ch
+			bestScore = score
+		}
+	}
+
+	if best == nil {
+		return 0, false
+	}
+
+	return best.desc.ID, true
+}
+
+func (m *mconn) writeNextChunk(chID byte) error {
+	m.mutex.Lock()
+	ch := m.channels[chID]
+	state := m.outbound[chID]
+
+	if state == nil {
+		select {
+		case msg := <-ch.queue:
+			state = &outboundState{msg: msg}
+			m.outbound[chID] = state
+		default:
+			m.mutex.Unlock()
+			return nil
+		}
+	}
+
+	end := state.offset + m.maxFrameSize
+	if end > len(state.msg) {
+		end = len(state.msg)
+	}
+	chunk := state.msg[state.offset:end]
+	eof := end == len(state.msg)
+	state.offset = end
+	if eof {
+		delete(m.outbound, chID)
+	}
+	m.mutex.Unlock()
+
+	frame := encodeFrame(chID, eof, chunk)
+	if err := m.conn.Send(frame); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	ch.recentBytes += int64(len(chunk))
+	m.decayLocked()
+	m.mutex.Unlock()
+
+	return nil
+}
+
+func (m *mconn) decayLocked() {
+	for _, ch := range m.channels {
+		ch.recentBytes = ch.recentBytes * 9 / 10
+	}
+}
@@ -0,0 +1,174 @@
+package mux_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-braun/nett"
+	"github.com/v-braun/nett/mux"
+)
+
+var descriptors = []mux.ChannelDescriptor{
+	{ID: 1, Priority: 10, SendQueueCapacity: 4},
+	{ID: 2, Priority: 1, SendQueueCapacity: 4},
+}
+
+func TestMuxSendReceive(t *testing.T) {
+	c1, c2 := net.Pipe()
+
+	client1 := nett.Wrap(c1, mux.FrameReader)
+	client2 := nett.Wrap(c2, mux.FrameReader)
+
+	m1 := mux.Wrap(client1, descriptors)
+	m2 := mux.Wrap(client2, descriptors)
+	defer m1.Close()
+	defer m2.Close()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	var received []byte
+	var receivedCh byte
+	m2.OnReceive(1, func(chID byte, msg []byte) {
+		receivedCh = chID
+		received = msg
+		wg.Done()
+	})
+
+	sent := m1.Send(1, []byte("hello mux"))
+	assert.True(t, sent)
+
+	wg.Wait()
+	assert.Equal(t, byte(1), receivedCh)
+	assert.Equal(t, "hello mux", string(received))
+}
+
+func TestMuxChunking(t *testing.T) {
+	c1, c2 := net.Pipe()
+
+	client1 := nett.Wrap(c1, mux.FrameReader)
+	client2 := nett.Wrap(c2, mux.FrameReader)
+
+	m1 := mux.Wrap(client1, descriptors, mux.MaxFrameSize(4))
+	m2 := mux.Wrap(client2, descriptors, mux.MaxFrameSize(4))
+	defer m1.Close()
+	defer m2.Close()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	large := []byte("this message is definitely longer than four bytes")
+	var received []byte
+	m2.OnReceive(2, func(chID byte, msg []byte) {
+		received = msg
+		wg.Done()
+	})
+
+	m1.SendWithBackpressure(2, large)
+	wg.Wait()
+
+	assert.Equal(t, string(large), string(received))
+}
+
+func TestMuxSendDropsWhenQueueFull(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	client1 := nett.Wrap(c1, mux.FrameReader)
+	full := []mux.ChannelDescriptor{{ID: 1, Priority: 1, SendQueueCapacity: 2}}
+	m1 := mux.Wrap(client1, full)
+	defer m1.Close()
+
+	// nobody reads c2, so the send loop blocks forever on its first
+	// in-flight write and the queue fills up permanently
+	successes := 0
+	for i := 0; i < 10; i++ {
+		if m1.Send(1, []byte{byte(i)}) {
+			successes++
+		}
+	}
+
+	assert.Less(t, successes, 10)
+}
+
+func TestMuxReassemblyDropsOversizedMessage(t *testing.T) {
+	c1, c2 := net.Pipe()
+
+	client1 := nett.Wrap(c1, mux.FrameReader)
+	client2 := nett.Wrap(c2, mux.FrameReader)
+
+	m1 := mux.Wrap(client1, descriptors, mux.MaxFrameSize(4))
+	m2 := mux.Wrap(client2, descriptors, mux.MaxFrameSize(4), mux.MaxMessageSize(8))
+	defer m1.Close()
+	defer m2.Close()
+
+	mutex := &sync.Mutex{}
+	var received []byte
+	done := make(chan struct{})
+	m2.OnReceive(1, func(chID byte, msg []byte) {
+		mutex.Lock()
+		received = msg
+		mutex.Unlock()
+		close(done)
+	})
+
+	// longer than m2's 8 byte MaxMessageSize, so m2 must drop it instead of
+	// growing its reassembly buffer without bound
+	m1.SendWithBackpressure(1, []byte("this message is longer than eight bytes"))
+
+	small := []byte("ok")
+	m1.SendWithBackpressure(1, small)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the message after the dropped oversized one to be delivered")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, string(small), string(received))
+}
+
+func TestMuxSendWithBackpressureUnblocksOnClose(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	client1 := nett.Wrap(c1, mux.FrameReader)
+	full := []mux.ChannelDescriptor{{ID: 1, Priority: 1, SendQueueCapacity: 1}}
+	m1 := mux.Wrap(client1, full)
+
+	// nobody reads c2, so the send loop stays permanently blocked on its
+	// in-flight write of the first message and the second one fills the queue
+	m1.SendWithBackpressure(1, []byte{0})
+	m1.SendWithBackpressure(1, []byte{1})
+
+	done := make(chan struct{})
+	go func() {
+		m1.SendWithBackpressure(1, []byte{2})
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	m1.Close()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected SendWithBackpressure to unblock once the mux closes")
+	}
+}
+
+func TestMuxSendUnknownChannel(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	client1 := nett.Wrap(c1, mux.FrameReader)
+	m1 := mux.Wrap(client1, descriptors)
+	defer m1.Close()
+
+	assert.False(t, m1.Send(99, []byte("nope")))
+}
@@ -10,6 +10,10 @@ var onDataNop = func(conn Connection, data []byte) {}
 var onErrNop = func(conn Connection, err error) {}
 var onClosedNop = func(conn Connection) {}
 
+// ReaderFunc decodes exactly one message from rawConn, blocking until it has
+// one or the connection errors (see Wrap)
+type ReaderFunc func(rawConn net.Conn) ([]byte, error)
+
 // Connection is the wrapping interface of net.Conn
 type Connection interface {
 
@@ -28,9 +32,26 @@ type Connection interface {
 	// Send sends the given data to the peer
 	Send(data []byte) error
 
-	// SendAsync is same as *Send* but runs in a goroutine
+	// SendAsync enqueues data on the connection's bounded send queue, where
+	// a single writer goroutine delivers it in order. Once the queue is
+	// full, behavior is governed by the connection's OverflowPolicy
 	SendAsync(data []byte)
 
+	// QueueLen returns the number of messages currently buffered in the send queue
+	QueueLen() int
+
+	// OnQueueOverflow registers the *handler* that will be called whenever
+	// SendAsync is called while the send queue is full
+	OnQueueOverflow(handler func(conn Connection))
+
+	// Metrics returns a snapshot of this connection's send counters
+	Metrics() Metrics
+
+	// OnReconnected registers the *handler* that will be called after this
+	// connection transparently re-establishes itself with its peer.
+	// Connections that never reconnect on their own (the common case) never call it
+	OnReconnected(handler func(conn Connection))
+
 	// Close will close the current connection
 	Close()
 }
@@ -54,13 +75,20 @@ var ReadLineReader = func(rawConn net.Conn) ([]byte, error) {
 }
 
 type conn struct {
-	inner    net.Conn
-	onData   (func(conn Connection, data []byte))
-	onErr    (func(conn Connection, err error))
-	onClosed (func(conn Connection))
-	reader   (func(rawConn net.Conn) ([]byte, error))
-	mutex    sync.Mutex
-	wg       sync.WaitGroup
+	inner           net.Conn
+	onData          (func(conn Connection, data []byte))
+	onErr           (func(conn Connection, err error))
+	onClosed        (func(conn Connection))
+	onQueueOverflow (func(conn Connection))
+	reader          (func(rawConn net.Conn) ([]byte, error))
+	opts            Options
+	closed          chan struct{}
+	closeOnce       sync.Once
+	pongCh          chan struct{}
+	sendQueue       chan []byte
+	metrics         queueMetrics
+	mutex           sync.Mutex
+	wg              sync.WaitGroup
 }
 
 // Wrap will wrap the given net.Conn connection and return a nett.Connection object
@@ -70,20 +98,28 @@ type conn struct {
 // The *reader* will be used in a goroutine to decode data from the network stream.
 // The return value of the reader will be passed into the *OnData* handler
 func Wrap(inner net.Conn, reader func(rawConn net.Conn) ([]byte, error)) Connection {
-	result := &conn{
-		inner:    inner,
-		onData:   onDataNop,
-		onErr:    onErrNop,
-		onClosed: onClosedNop,
-		reader:   reader,
-		mutex:    sync.Mutex{},
-		wg:       sync.WaitGroup{},
-	}
+	return WrapWithOptions(inner, reader, Options{})
+}
 
-	result.wg.Add(1)
-	go result.runRead()
+func newConn(inner net.Conn, reader func(rawConn net.Conn) ([]byte, error), opts Options) *conn {
+	return &conn{
+		inner:           inner,
+		onData:          onDataNop,
+		onErr:           onErrNop,
+		onClosed:        onClosedNop,
+		onQueueOverflow: onQueueOverflowNop,
+		reader:          reader,
+		opts:            opts,
+		closed:          make(chan struct{}),
+		pongCh:          make(chan struct{}, 1),
+		sendQueue:       make(chan []byte, opts.sendQueueSize()),
+		mutex:           sync.Mutex{},
+		wg:              sync.WaitGroup{},
+	}
+}
 
-	return result
+func (c *conn) markClosed() {
+	c.closeOnce.Do(func() { close(c.closed) })
 }
 
 func (c *conn) Raw() net.Conn {
@@ -129,18 +165,9 @@ func (c *conn) Send(data []byte) error {
 	return nil
 }
 
-func (c *conn) SendAsync(data []byte) {
-	c.wg.Add(1)
-	go func(c *conn, data []byte) {
-		defer c.wg.Done()
-
-		err := c.Send(data)
-		if err = hideTempError(err); err != nil {
-			c.notifyErr(err)
-			return
-		}
-	}(c, data)
-}
+// OnReconnected is a no-op: a conn created via Wrap/WrapWithOptions never
+// reconnects itself; use Dial for an auto-reconnecting Connection.
+func (c *conn) OnReconnected(handler func(conn Connection)) {}
 
 func (c *conn) Close() {
 	c.inner.Close()
@@ -150,6 +177,7 @@ func (c *conn) Close() {
 func (c *conn) runRead() {
 	defer func() {
 		c.inner.Close()
+		c.markClosed()
 		c.wg.Done()
 		go c.notifyClose()
 	}()
@@ -166,6 +194,9 @@ func (c *conn) runRead() {
 		}
 
 		if len(data) > 0 {
+			if c.handleKeepaliveFrame(data) {
+				continue
+			}
 			c.notifyData(data)
 		}
 	}
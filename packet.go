@@ -0,0 +1,401 @@
+package nett
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+var onPacketDataNop = func(conn PacketConnection, data []byte, remoteAddr net.Addr) {}
+var onPacketErrNop = func(conn PacketConnection, err error) {}
+var onPacketClosedNop = func(conn PacketConnection) {}
+
+// defaultIdleTimeout is how long a Session may stay idle before WrapPacket evicts and closes it.
+const defaultIdleTimeout = 2 * time.Minute
+
+// PacketConnection is the event based interface around a net.PacketConn,
+// letting UDP, DTLS or other datagram transports plug into the same event
+// API as the TCP oriented Connection.
+type PacketConnection interface {
+
+	// Raw returns the underlining net.PacketConn
+	Raw() net.PacketConn
+
+	// OnData registers the *handler* that will be called for every
+	// received datagram, together with the remote address it came from
+	OnData(handler func(conn PacketConnection, data []byte, remoteAddr net.Addr))
+
+	// OnErr registers the *handler* that will be called on an error during the communication
+	OnErr(handler func(conn PacketConnection, err error))
+
+	// OnClosed registers the *handler* that will be called when the connection was closed
+	OnClosed(handler func(conn PacketConnection))
+
+	// SendTo writes a single datagram to addr
+	SendTo(data []byte, addr net.Addr) error
+
+	// Session returns a virtual, stream-like Connection scoped to addr: it
+	// has its own OnData/OnClosed lifetime and is evicted (and closed)
+	// after the configured idle timeout, letting a single socket be
+	// treated as many logical sessions
+	Session(addr net.Addr) Connection
+
+	// Close closes the underlining net.PacketConn and every still open Session
+	Close()
+}
+
+// PacketOption configures a PacketConnection created via WrapPacket.
+type PacketOption func(*packetConn)
+
+// WithIdleTimeout overrides the default 2 minute idle timeout used to evict
+// Sessions. A non-positive d is ignored (the default is kept), since
+// time.NewTicker requires a positive duration.
+func WithIdleTimeout(d time.Duration) PacketOption {
+	return func(p *packetConn) {
+		if d > 0 {
+			p.idleTimeout = d
+		}
+	}
+}
+
+type packetConn struct {
+	inner       net.PacketConn
+	onData      func(conn PacketConnection, data []byte, remoteAddr net.Addr)
+	onErr       func(conn PacketConnection, err error)
+	onClosed    func(conn PacketConnection)
+	sessions    map[string]*session
+	idleTimeout time.Duration
+	closed      chan struct{}
+	closeOnce   sync.Once
+	mutex       sync.Mutex
+	wg          sync.WaitGroup
+}
+
+// WrapPacket wraps the given net.PacketConn and returns a nett.PacketConnection
+// that delivers every received datagram via OnData (tagged with its sender
+// address) and lets you write individual datagrams via SendTo.
+func WrapPacket(pc net.PacketConn, opts ...PacketOption) PacketConnection {
+	result := &packetConn{
+		inner:       pc,
+		onData:      onPacketDataNop,
+		onErr:       onPacketErrNop,
+		onClosed:    onPacketClosedNop,
+		sessions:    map[string]*session{},
+		idleTimeout: defaultIdleTimeout,
+		closed:      make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(result)
+	}
+
+	result.wg.Add(2)
+	go result.runRead()
+	go result.runEviction()
+
+	return result
+}
+
+func (p *packetConn) Raw() net.PacketConn {
+	return p.inner
+}
+
+func (p *packetConn) OnData(handler func(conn PacketConnection, data []byte, remoteAddr net.Addr)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if handler == nil {
+		handler = onPacketDataNop
+	}
+
+	p.onData = handler
+}
+
+func (p *packetConn) OnErr(handler func(conn PacketConnection, err error)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if handler == nil {
+		handler = onPacketErrNop
+	}
+
+	p.onErr = handler
+}
+
+func (p *packetConn) OnClosed(handler func(conn PacketConnection)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if handler == nil {
+		handler = onPacketClosedNop
+	}
+
+	p.onClosed = handler
+}
+
+func (p *packetConn) SendTo(data []byte, addr net.Addr) error {
+	_, err := p.inner.WriteTo(data, addr)
+	return err
+}
+
+func (p *packetConn) Session(addr net.Addr) Connection {
+	return p.sessionFor(addr)
+}
+
+func (p *packetConn) Close() {
+	p.markClosed()
+	p.inner.Close()
+	p.wg.Wait()
+
+	p.mutex.Lock()
+	sessions := make([]*session, 0, len(p.sessions))
+	for _, s := range p.sessions {
+		sessions = append(sessions, s)
+	}
+	p.mutex.Unlock()
+
+	for _, s := range sessions {
+		s.Close()
+	}
+}
+
+func (p *packetConn) markClosed() {
+	p.closeOnce.Do(func() { close(p.closed) })
+}
+
+func (p *packetConn) runRead() {
+	defer func() {
+		p.markClosed()
+		p.wg.Done()
+		go p.notifyClosed()
+	}()
+
+	buffer := make([]byte, 65535)
+	for {
+		n, addr, err := p.inner.ReadFrom(buffer)
+		if err != nil {
+			if !isClosedConnErrr(err) {
+				p.notifyErr(err)
+			}
+			return
+		}
+
+		data := make([]byte, n)
+		copy(data, buffer[:n])
+
+		p.notifyData(data, addr)
+		p.sessionFor(addr).deliver(data)
+	}
+}
+
+func (p *packetConn) runEviction() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.evictIdleSessions()
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+func (p *packetConn) evictIdleSessions() {
+	cutoff := time.Now().Add(-p.idleTimeout)
+
+	p.mutex.Lock()
+	stale := make([]*session, 0)
+	for key, s := range p.sessions {
+		if s.lastSeenBefore(cutoff) {
+			stale = append(stale, s)
+			delete(p.sessions, key)
+		}
+	}
+	p.mutex.Unlock()
+
+	for _, s := range stale {
+		s.Close()
+	}
+}
+
+func (p *packetConn) sessionFor(addr net.Addr) *session {
+	key := addr.String()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	s, ok := p.sessions[key]
+	if !ok || s.isClosed() {
+		s = newSession(p.inner, addr)
+		p.sessions[key] = s
+	}
+
+	return s
+}
+
+func (p *packetConn) notifyData(data []byte, addr net.Addr) {
+	p.mutex.Lock()
+	handler := p.onData
+	p.mutex.Unlock()
+
+	handler(p, data, addr)
+}
+
+func (p *packetConn) notifyErr(err error) {
+	p.mutex.Lock()
+	handler := p.onErr
+	p.mutex.Unlock()
+
+	handler(p, err)
+}
+
+func (p *packetConn) notifyClosed() {
+	p.mutex.Lock()
+	handler := p.onClosed
+	p.mutex.Unlock()
+
+	handler(p)
+}
+
+// session is the virtual, stream-like Connection backing PacketConnection.Session.
+// It has no real net.Conn behind it, so Raw always returns nil.
+type session struct {
+	pc       net.PacketConn
+	addr     net.Addr
+	onData   func(conn Connection, data []byte)
+	onErr    func(conn Connection, err error)
+	onClosed func(conn Connection)
+	lastSeen time.Time
+	closed   bool
+	mutex    sync.Mutex
+}
+
+func newSession(pc net.PacketConn, addr net.Addr) *session {
+	return &session{
+		pc:       pc,
+		addr:     addr,
+		onData:   onDataNop,
+		onErr:    onErrNop,
+		onClosed: onClosedNop,
+		lastSeen: time.Now(),
+	}
+}
+
+func (s *session) Raw() net.Conn {
+	return nil
+}
+
+func (s *session) OnData(handler func(conn Connection, data []byte)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if handler == nil {
+		handler = onDataNop
+	}
+
+	s.onData = handler
+}
+
+func (s *session) OnErr(handler func(conn Connection, err error)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if handler == nil {
+		handler = onErrNop
+	}
+
+	s.onErr = handler
+}
+
+func (s *session) OnClosed(handler func(conn Connection)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if handler == nil {
+		handler = onClosedNop
+	}
+
+	s.onClosed = handler
+}
+
+func (s *session) Send(data []byte) error {
+	_, err := s.pc.WriteTo(data, s.addr)
+	return err
+}
+
+func (s *session) SendAsync(data []byte) {
+	go func() {
+		if err := s.Send(data); err != nil {
+			s.mutex.Lock()
+			handler := s.onErr
+			s.mutex.Unlock()
+
+			handler(s, err)
+		}
+	}()
+}
+
+// QueueLen always returns 0: a session has no send queue, SendAsync just
+// fires a datagram write in its own goroutine.
+func (s *session) QueueLen() int {
+	return 0
+}
+
+// OnQueueOverflow is a no-op: a session's SendAsync never drops a datagram for queue pressure.
+func (s *session) OnQueueOverflow(handler func(conn Connection)) {}
+
+// Metrics always returns the zero value: a session doesn't track send counters.
+func (s *session) Metrics() Metrics {
+	return Metrics{}
+}
+
+// OnReconnected is a no-op: a session never reconnects on its own.
+func (s *session) OnReconnected(handler func(conn Connection)) {}
+
+func (s *session) Close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	handler := s.onClosed
+	s.mutex.Unlock()
+
+	handler(s)
+}
+
+func (s *session) deliver(data []byte) {
+	s.mutex.Lock()
+	closed := s.closed
+	if !closed {
+		s.lastSeen = time.Now()
+	}
+	handler := s.onData
+	s.mutex.Unlock()
+
+	if !closed {
+		handler(s, data)
+	}
+}
+
+func (s *session) lastSeenBefore(cutoff time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.lastSeen.Before(cutoff)
+}
+
+// isClosed reports whether Close has already been called, so sessionFor can
+// replace a closed-but-still-cached session instead of reusing (and
+// black-holing datagrams into) it.
+func (s *session) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closed
+}
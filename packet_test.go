@@ -0,0 +1,145 @@
+package nett_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-braun/nett"
+)
+
+func TestWrapPacketSendReceive(t *testing.T) {
+	serverPC, err := net.ListenPacket("udp", "localhost:0")
+	assert.NoError(t, err)
+	clientPC, err := net.ListenPacket("udp", "localhost:0")
+	assert.NoError(t, err)
+
+	server := nett.WrapPacket(serverPC)
+	client := nett.WrapPacket(clientPC)
+	defer server.Close()
+	defer client.Close()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	var received []byte
+	var from net.Addr
+	server.OnData(func(conn nett.PacketConnection, data []byte, remoteAddr net.Addr) {
+		received = data
+		from = remoteAddr
+		wg.Done()
+	})
+
+	err = client.SendTo(mockMsg, serverPC.LocalAddr())
+	assert.NoError(t, err)
+
+	wg.Wait()
+	assert.Equal(t, mockMsg, received)
+	assert.NotNil(t, from)
+}
+
+func TestWithIdleTimeoutIgnoresNonPositiveDuration(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "localhost:0")
+	assert.NoError(t, err)
+
+	// a non-positive idle timeout must not panic the eviction ticker;
+	// it should just keep the default instead
+	conn := nett.WrapPacket(pc, nett.WithIdleTimeout(0))
+	defer conn.Close()
+}
+
+func TestClosedSessionIsReplacedByFreshOne(t *testing.T) {
+	serverPC, err := net.ListenPacket("udp", "localhost:0")
+	assert.NoError(t, err)
+	clientPC, err := net.ListenPacket("udp", "localhost:0")
+	assert.NoError(t, err)
+
+	server := nett.WrapPacket(serverPC)
+	client := nett.WrapPacket(clientPC)
+	defer server.Close()
+	defer client.Close()
+
+	var first nett.Connection
+	firstSeen := make(chan struct{})
+	server.OnData(func(conn nett.PacketConnection, data []byte, remoteAddr net.Addr) {
+		if first == nil {
+			first = conn.Session(remoteAddr)
+			close(firstSeen)
+		}
+	})
+
+	err = client.SendTo(mockMsg, serverPC.LocalAddr())
+	assert.NoError(t, err)
+	<-firstSeen
+
+	// closing the session the caller owns must not leave it cached forever:
+	// the next datagram from the same remote address should spawn a new,
+	// live session instead of being silently dropped by the dead one
+	first.Close()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	var second nett.Connection
+	server.OnData(func(conn nett.PacketConnection, data []byte, remoteAddr net.Addr) {
+		second = conn.Session(remoteAddr)
+		second.OnData(func(conn nett.Connection, data []byte) {
+			wg.Done()
+		})
+	})
+
+	err = client.SendTo(mockMsg, serverPC.LocalAddr())
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a fresh session to receive the datagram after the old one was closed")
+	}
+
+	assert.NotSame(t, first, second)
+}
+
+func TestWrapPacketSession(t *testing.T) {
+	serverPC, err := net.ListenPacket("udp", "localhost:0")
+	assert.NoError(t, err)
+	clientPC, err := net.ListenPacket("udp", "localhost:0")
+	assert.NoError(t, err)
+
+	server := nett.WrapPacket(serverPC, nett.WithIdleTimeout(50*time.Millisecond))
+	client := nett.WrapPacket(clientPC)
+	defer server.Close()
+	defer client.Close()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	server.OnData(func(conn nett.PacketConnection, data []byte, remoteAddr net.Addr) {
+		conn.Session(remoteAddr).OnData(func(conn nett.Connection, data []byte) {
+			wg.Done()
+		})
+	})
+
+	err = client.SendTo(mockMsg, serverPC.LocalAddr())
+	assert.NoError(t, err)
+	wg.Wait()
+
+	// second datagram from the same peer should hit the same session
+	wg2 := &sync.WaitGroup{}
+	wg2.Add(1)
+	server.OnData(func(conn nett.PacketConnection, data []byte, remoteAddr net.Addr) {
+		conn.Session(remoteAddr).OnData(func(conn nett.Connection, data []byte) {
+			wg2.Done()
+		})
+	})
+	err = client.SendTo(mockMsg, serverPC.LocalAddr())
+	assert.NoError(t, err)
+	wg2.Wait()
+}
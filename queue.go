@@ -0,0 +1,158 @@
+package nett
+
+import "sync/atomic"
+
+var onQueueOverflowNop = func(conn Connection) {}
+
+const defaultSendQueueSize = 64
+
+// OverflowPolicy decides what SendAsync does once a connection's send queue is full.
+type OverflowPolicy int
+
+const (
+	// Block makes SendAsync wait for room in the queue (or for the
+	// connection to close). This is the default.
+	Block OverflowPolicy = iota
+
+	// DropNewest discards the message passed to the full SendAsync call.
+	DropNewest
+
+	// DropOldest discards the oldest still-queued message to make room for the new one.
+	DropOldest
+
+	// CloseOnOverflow discards the message and closes the connection.
+	CloseOnOverflow
+)
+
+// Metrics is a snapshot of a connection's send queue counters.
+type Metrics struct {
+	// Enqueued is how many messages were handed to SendAsync
+	Enqueued uint64
+
+	// Dropped is how many of those messages never reached the wire because the queue was full
+	Dropped uint64
+
+	// SentBytes is how many payload bytes the writer goroutine has written to the peer
+	SentBytes uint64
+}
+
+type queueMetrics struct {
+	enqueued  uint64
+	dropped   uint64
+	sentBytes uint64
+}
+
+func (o Options) sendQueueSize() int {
+	if o.SendQueueSize > 0 {
+		return o.SendQueueSize
+	}
+	return defaultSendQueueSize
+}
+
+func (c *conn) SendAsync(data []byte) {
+	atomic.AddUint64(&c.metrics.enqueued, 1)
+
+	select {
+	case <-c.closed:
+		// the writer goroutine is already gone, so queuing here would
+		// strand data forever; fall back to a direct, one-off write so
+		// the caller still gets the resulting error via OnErr
+		go func() {
+			if err := c.Send(data); err != nil {
+				c.notifyErr(err)
+			}
+		}()
+		return
+	default:
+	}
+
+	select {
+	case c.sendQueue <- data:
+		return
+	default:
+	}
+
+	c.notifyQueueOverflow()
+
+	switch c.opts.OverflowPolicy {
+	case DropOldest:
+		select {
+		case <-c.sendQueue:
+			atomic.AddUint64(&c.metrics.dropped, 1)
+		default:
+		}
+		select {
+		case c.sendQueue <- data:
+		default:
+			atomic.AddUint64(&c.metrics.dropped, 1)
+		}
+	case CloseOnOverflow:
+		atomic.AddUint64(&c.metrics.dropped, 1)
+		// Close() blocks on wg.Wait(), but SendAsync is commonly called
+		// from a wg-tracked goroutine itself (an OnData handler, or the
+		// keepalive ping/pong path) - waiting here would deadlock on
+		// that very goroutine. Signal the close and let inner.Close()
+		// unblock the readers/writers asynchronously instead.
+		c.markClosed()
+		go c.inner.Close()
+	case DropNewest:
+		atomic.AddUint64(&c.metrics.dropped, 1)
+	default: // Block
+		select {
+		case c.sendQueue <- data:
+		case <-c.closed:
+			atomic.AddUint64(&c.metrics.dropped, 1)
+		}
+	}
+}
+
+func (c *conn) QueueLen() int {
+	return len(c.sendQueue)
+}
+
+func (c *conn) OnQueueOverflow(handler func(conn Connection)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if handler == nil {
+		handler = onQueueOverflowNop
+	}
+
+	c.onQueueOverflow = handler
+}
+
+func (c *conn) Metrics() Metrics {
+	return Metrics{
+		Enqueued:  atomic.LoadUint64(&c.metrics.enqueued),
+		Dropped:   atomic.LoadUint64(&c.metrics.dropped),
+		SentBytes: atomic.LoadUint64(&c.metrics.sentBytes),
+	}
+}
+
+func (c *conn) notifyQueueOverflow() {
+	c.mutex.Lock()
+	handler := c.onQueueOverflow
+	c.mutex.Unlock()
+
+	handler(c)
+}
+
+// runWrite is the single writer goroutine draining the send queue, so
+// concurrent SendAsync calls can no longer interleave writes on inner.
+func (c *conn) runWrite() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case data := <-c.sendQueue:
+			err := c.Send(data)
+			if err = hideTempError(err); err != nil {
+				c.notifyErr(err)
+				return
+			}
+			atomic.AddUint64(&c.metrics.sentBytes, uint64(len(data)))
+		case <-c.closed:
+			return
+		}
+	}
+}
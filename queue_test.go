@@ -0,0 +1,108 @@
+package nett_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/v-braun/nett"
+)
+
+func TestSendAsyncPreservesOrder(t *testing.T) {
+	c1, c2 := createClients(t)
+
+	client1 := nett.Wrap(c1, nett.ReadLineReader)
+	client2 := nett.Wrap(c2, nett.ReadLineReader)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+
+	var received []string
+	mutex := &sync.Mutex{}
+	client2.OnData(func(conn nett.Connection, data []byte) {
+		mutex.Lock()
+		received = append(received, string(data))
+		mutex.Unlock()
+		wg.Done()
+	})
+
+	client1.SendAsync([]byte("a\n"))
+	client1.SendAsync([]byte("b\n"))
+	client1.SendAsync([]byte("c\n"))
+
+	wg.Wait()
+	assert.Equal(t, []string{"a\n", "b\n", "c\n"}, received)
+
+	client1.Close()
+	client2.Close()
+}
+
+func TestSendAsyncDropNewestWhenFull(t *testing.T) {
+	c1, c2 := createClients(t)
+	defer c2.Close()
+
+	opts := nett.Options{SendQueueSize: 1, OverflowPolicy: nett.DropNewest}
+	client1 := nett.WrapWithOptions(c1, nett.ReadLineReader, opts)
+	defer client1.Close()
+
+	overflowed := make(chan struct{}, 16)
+	client1.OnQueueOverflow(func(conn nett.Connection) {
+		overflowed <- struct{}{}
+	})
+
+	for i := 0; i < 10; i++ {
+		client1.SendAsync([]byte("x"))
+	}
+
+	select {
+	case <-overflowed:
+	case <-time.After(time.Second):
+		t.Fatal("expected at least one queue overflow")
+	}
+
+	metrics := client1.Metrics()
+	assert.Equal(t, uint64(10), metrics.Enqueued)
+	assert.True(t, metrics.Dropped > 0)
+}
+
+func TestSendAsyncCloseOnOverflowFromOnData(t *testing.T) {
+	// net.Pipe is synchronous: nobody ever reads the peer side below, so
+	// the write runWrite dequeues first blocks forever, and once the single
+	// queue slot is taken the next SendAsync call overflows deterministically.
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	opts := nett.Options{SendQueueSize: 1, OverflowPolicy: nett.CloseOnOverflow}
+	client1 := nett.WrapWithOptions(c1, nett.ReadLineReader, opts)
+
+	done := make(chan struct{})
+	client1.OnData(func(conn nett.Connection, data []byte) {
+		// SendAsync runs on this very runRead goroutine; with the old
+		// blocking c.Close() this deadlocked on its own wg.Wait().
+		for i := 0; i < 5; i++ {
+			conn.SendAsync([]byte("x"))
+		}
+		close(done)
+	})
+
+	go c2.Write([]byte("hi\n"))
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected CloseOnOverflow SendAsync called from OnData to not deadlock")
+	}
+}
+
+func TestQueueLen(t *testing.T) {
+	c1, c2 := createClients(t)
+	defer c2.Close()
+
+	opts := nett.Options{SendQueueSize: 4, OverflowPolicy: nett.Block}
+	client1 := nett.WrapWithOptions(c1, nett.ReadLineReader, opts)
+	defer client1.Close()
+
+	assert.Equal(t, 0, client1.QueueLen())
+}